@@ -0,0 +1,240 @@
+package systray
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+const (
+	IMAGE_ICON      = 1
+	LR_LOADFROMFILE = 0x00000010
+	LR_DEFAULTSIZE  = 0x00000040
+
+	SM_CXMENUCHECK = 71
+	SM_CYMENUCHECK = 72
+	DIB_RGB_COLORS = 0
+	DI_NORMAL      = 0x0003
+	BI_RGB         = 0
+)
+
+var (
+	modGdi32 = windows.NewLazySystemDLL("gdi32.dll")
+
+	procLoadImage          = modUser32.NewProc("LoadImageW")
+	procDestroyIcon        = modUser32.NewProc("DestroyIcon")
+	procGetSystemMetrics   = modUser32.NewProc("GetSystemMetrics")
+	procDrawIconEx         = modUser32.NewProc("DrawIconEx")
+	procCreateCompatibleDC = modGdi32.NewProc("CreateCompatibleDC")
+	procCreateDIBSection   = modGdi32.NewProc("CreateDIBSection")
+	procSelectObject       = modGdi32.NewProc("SelectObject")
+	procDeleteDC           = modGdi32.NewProc("DeleteDC")
+	procDeleteObject       = modGdi32.NewProc("DeleteObject")
+)
+
+// bitmapInfoHeader mirrors the Win32 BITMAPINFOHEADER structure.
+type bitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+// SetIconFromFile is like SetIcon but reads the icon (ICO or PNG) from a
+// path on disk.
+func SetIconFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read icon file: %w", err)
+	}
+	return SetIcon(data)
+}
+
+// loadIconFromBytes loads iconBytes (ICO, or PNG re-encoded to ICO) as an
+// HICON via a cached temp file.
+func loadIconFromBytes(iconBytes []byte) (windows.Handle, error) {
+	if bytes.HasPrefix(iconBytes, pngMagic) {
+		img, err := png.Decode(bytes.NewReader(iconBytes))
+		if err != nil {
+			return 0, fmt.Errorf("decode PNG icon: %w", err)
+		}
+		if iconBytes, err = encodeICO(img); err != nil {
+			return 0, err
+		}
+	}
+
+	path, err := cachedIconPath(iconBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	ret, _, err := procLoadImage.Call(
+		0,
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(IMAGE_ICON),
+		0,
+		0,
+		uintptr(LR_LOADFROMFILE|LR_DEFAULTSIZE),
+	)
+	if ret == 0 {
+		return 0, fmt.Errorf("LoadImage failed: %w", err)
+	}
+	return windows.Handle(ret), nil
+}
+
+// cachedIconPath writes iconBytes to a content-addressed file under
+// %TEMP%, skipping the write if it's already there, so repeated SetIcon
+// calls with the same bytes are cheap.
+func cachedIconPath(iconBytes []byte) (string, error) {
+	sum := md5.Sum(iconBytes)
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("winsystray-%x.ico", sum))
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := os.WriteFile(path, iconBytes, 0o644); err != nil {
+		return "", fmt.Errorf("write temp icon file: %w", err)
+	}
+	return path, nil
+}
+
+// encodeICO packs img into a minimal single-frame 32-bpp ICO file:
+// BITMAPINFOHEADER, a bottom-up BGRA pixel array, and an all-zero AND
+// mask (transparency is carried by the alpha channel instead).
+func encodeICO(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || width > 256 || height <= 0 || height > 256 {
+		return nil, fmt.Errorf("icon dimensions %dx%d out of range", width, height)
+	}
+
+	pixels := make([]byte, width*height*4)
+	for y := 0; y < height; y++ {
+		dstRow := height - 1 - y
+		for x := 0; x < width; x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			o := (dstRow*width + x) * 4
+			pixels[o+0] = byte(b >> 8)
+			pixels[o+1] = byte(g >> 8)
+			pixels[o+2] = byte(r >> 8)
+			pixels[o+3] = byte(a >> 8)
+		}
+	}
+
+	maskStride := ((width + 31) / 32) * 4
+	mask := make([]byte, maskStride*height)
+
+	bi := bitmapInfoHeader{
+		Width:       int32(width),
+		Height:      int32(height * 2), // ICO convention: XOR + AND mask stacked
+		Planes:      1,
+		BitCount:    32,
+		Compression: BI_RGB,
+		SizeImage:   uint32(len(pixels) + len(mask)),
+	}
+	bi.Size = uint32(unsafe.Sizeof(bi))
+
+	var imgBuf bytes.Buffer
+	binary.Write(&imgBuf, binary.LittleEndian, &bi)
+	imgBuf.Write(pixels)
+	imgBuf.Write(mask)
+
+	dirWidth, dirHeight := byte(width), byte(height)
+	if width == 256 {
+		dirWidth = 0
+	}
+	if height == 256 {
+		dirHeight = 0
+	}
+
+	var ico bytes.Buffer
+	binary.Write(&ico, binary.LittleEndian, uint16(0)) // reserved
+	binary.Write(&ico, binary.LittleEndian, uint16(1)) // type: icon
+	binary.Write(&ico, binary.LittleEndian, uint16(1)) // image count
+	binary.Write(&ico, binary.LittleEndian, dirWidth)
+	binary.Write(&ico, binary.LittleEndian, dirHeight)
+	binary.Write(&ico, binary.LittleEndian, byte(0)) // color count
+	binary.Write(&ico, binary.LittleEndian, byte(0)) // reserved
+	binary.Write(&ico, binary.LittleEndian, uint16(1))
+	binary.Write(&ico, binary.LittleEndian, uint16(32))
+	binary.Write(&ico, binary.LittleEndian, uint32(imgBuf.Len()))
+	binary.Write(&ico, binary.LittleEndian, uint32(22)) // offset: 6-byte header + 16-byte dir entry
+	ico.Write(imgBuf.Bytes())
+
+	return ico.Bytes(), nil
+}
+
+func destroyIcon(icon windows.Handle) {
+	procDestroyIcon.Call(uintptr(icon))
+}
+
+// iconToMenuBitmap renders hIcon into a 32-bpp top-down HBITMAP sized
+// for a menu item (SM_CXMENUCHECK x SM_CYMENUCHECK), suitable for
+// MENUITEMINFO.HbmpItem. The caller owns the returned bitmap and must
+// free it with deleteBitmap once the menu using it is torn down.
+func iconToMenuBitmap(hIcon windows.Handle) (windows.Handle, error) {
+	cx, _, _ := procGetSystemMetrics.Call(uintptr(SM_CXMENUCHECK))
+	cy, _, _ := procGetSystemMetrics.Call(uintptr(SM_CYMENUCHECK))
+
+	hdc, _, _ := procCreateCompatibleDC.Call(0)
+	if hdc == 0 {
+		return 0, fmt.Errorf("CreateCompatibleDC failed")
+	}
+	defer procDeleteDC.Call(hdc)
+
+	bi := bitmapInfoHeader{
+		Width:       int32(cx),
+		Height:      -int32(cy), // negative height selects a top-down DIB
+		Planes:      1,
+		BitCount:    32,
+		Compression: BI_RGB,
+	}
+	bi.Size = uint32(unsafe.Sizeof(bi))
+
+	var bits unsafe.Pointer
+	hbmp, _, err := procCreateDIBSection.Call(
+		hdc,
+		uintptr(unsafe.Pointer(&bi)),
+		uintptr(DIB_RGB_COLORS),
+		uintptr(unsafe.Pointer(&bits)),
+		0,
+		0,
+	)
+	if hbmp == 0 {
+		return 0, fmt.Errorf("CreateDIBSection failed: %w", err)
+	}
+
+	oldObj, _, _ := procSelectObject.Call(hdc, hbmp)
+	defer procSelectObject.Call(hdc, oldObj)
+
+	procDrawIconEx.Call(hdc, 0, 0, uintptr(hIcon), cx, cy, 0, 0, uintptr(DI_NORMAL))
+
+	return windows.Handle(hbmp), nil
+}
+
+func deleteBitmap(hbmp windows.Handle) {
+	procDeleteObject.Call(uintptr(hbmp))
+}
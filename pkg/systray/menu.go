@@ -0,0 +1,296 @@
+package systray
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// MenuItem is a handle to a tray context-menu entry created by
+// AddMenuItem or AddSubMenuItem. A click on the item sends a value on
+// ClickedCh; callers should range over it (or select on it alongside
+// other channels) from a long-running goroutine.
+type MenuItem struct {
+	id        uint32
+	title     string
+	tooltip   string
+	ClickedCh chan struct{}
+
+	checked  bool
+	disabled bool
+	hidden   bool
+	icon     []byte
+
+	parent   *MenuItem
+	children []*MenuItem
+}
+
+var (
+	nextID   uint32 = firstCommandID
+	items           = map[uint32]*MenuItem{}
+	topLevel []*MenuItem
+
+	procInsertMenuItem = modUser32.NewProc("InsertMenuItemW")
+)
+
+// MENUITEMINFO mirrors the Win32 MENUITEMINFOW structure.
+type MENUITEMINFO struct {
+	CbSize        uint32
+	FMask         uint32
+	FType         uint32
+	FState        uint32
+	WID           uint32
+	HSubMenu      windows.Handle
+	HbmpChecked   windows.Handle
+	HbmpUnchecked windows.Handle
+	DwItemData    uintptr
+	DwTypeData    *uint16
+	Cch           uint32
+	HbmpItem      windows.Handle
+}
+
+const (
+	MIIM_STATE   = 0x00000001
+	MIIM_ID      = 0x00000002
+	MIIM_SUBMENU = 0x00000004
+	MIIM_STRING  = 0x00000040
+	MIIM_BITMAP  = 0x00000080
+	MIIM_FTYPE   = 0x00000100
+
+	MFT_STRING    = 0x00000000
+	MFT_SEPARATOR = 0x00000800
+
+	MF_STRING       = 0x00000000
+	MF_SEPARATOR    = 0x00000800
+	MF_CHECKED      = 0x00000008
+	MF_GRAYED       = 0x00000001
+	TPM_BOTTOMALIGN = 0x0020
+	TPM_LEFTALIGN   = 0x0000
+	TPM_RIGHTBUTTON = 0x0002
+)
+
+// AddMenuItem adds a new item to the tray's right-click menu and returns
+// a handle for reacting to clicks and changing its state at runtime.
+func AddMenuItem(title, tooltip string) *MenuItem {
+	return newMenuItem(nil, title, tooltip)
+}
+
+// AddSeparator adds a non-clickable dividing line to the top-level menu.
+func AddSeparator() {
+	mu.Lock()
+	defer mu.Unlock()
+	topLevel = append(topLevel, &MenuItem{})
+}
+
+// AddSubMenuItem adds title as a child entry of m, nesting it in a
+// submenu that opens when m is hovered.
+func (m *MenuItem) AddSubMenuItem(title, tooltip string) *MenuItem {
+	return newMenuItem(m, title, tooltip)
+}
+
+func newMenuItem(parent *MenuItem, title, tooltip string) *MenuItem {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item := &MenuItem{
+		id:        nextID,
+		title:     title,
+		tooltip:   tooltip,
+		ClickedCh: make(chan struct{}, 1),
+		parent:    parent,
+	}
+	nextID++
+	items[item.id] = item
+
+	if parent != nil {
+		parent.children = append(parent.children, item)
+	} else {
+		topLevel = append(topLevel, item)
+	}
+	return item
+}
+
+// Enable allows the item to be clicked.
+func (m *MenuItem) Enable() { m.setDisabled(false) }
+
+// Disable greys the item out and prevents it from being clicked.
+func (m *MenuItem) Disable() { m.setDisabled(true) }
+
+// Check puts a checkmark next to the item.
+func (m *MenuItem) Check() { m.setChecked(true) }
+
+// Uncheck removes the item's checkmark.
+func (m *MenuItem) Uncheck() { m.setChecked(false) }
+
+// Hide removes the item from the menu without discarding it; Show brings
+// it back.
+func (m *MenuItem) Hide() { m.setHidden(true) }
+
+// Show restores an item previously hidden with Hide.
+func (m *MenuItem) Show() { m.setHidden(false) }
+
+// SetIcon sets a per-item icon, shown to the left of the item's text.
+// iconBytes are interpreted the same way as the package-level SetIcon.
+func (m *MenuItem) SetIcon(iconBytes []byte) {
+	mu.Lock()
+	m.icon = iconBytes
+	mu.Unlock()
+}
+
+func (m *MenuItem) setDisabled(v bool) {
+	mu.Lock()
+	m.disabled = v
+	mu.Unlock()
+}
+
+func (m *MenuItem) setChecked(v bool) {
+	mu.Lock()
+	m.checked = v
+	mu.Unlock()
+}
+
+func (m *MenuItem) setHidden(v bool) {
+	mu.Lock()
+	m.hidden = v
+	mu.Unlock()
+}
+
+// dispatchCommand routes a WM_COMMAND's item ID to the matching
+// MenuItem's ClickedCh.
+func dispatchCommand(id uint32) {
+	mu.Lock()
+	item := items[id]
+	mu.Unlock()
+
+	if item == nil || item.disabled {
+		return
+	}
+
+	select {
+	case item.ClickedCh <- struct{}{}:
+	default:
+	}
+}
+
+// showMenu builds the popup menu tree from the registered items and
+// tracks it at the current cursor position.
+//
+// The HMENU is built fresh from topLevel via InsertMenuItemW on every
+// open and destroyed again once TrackPopupMenu returns, rather than kept
+// around and patched in place with SetMenuItemInfoW between opens. A
+// popup menu only exists while it's tracked, so there's no live HMENU
+// for SetMenuItemInfoW to update in between right-clicks anyway; building
+// fresh from the current MenuItem state each time gets the same result -
+// added, hidden/shown, checked, disabled and icon changes always
+// reflected - with less bookkeeping and nothing left over to leak. Items
+// cannot be removed or reordered once added; Hide only leaves one out of
+// the menu.
+func showMenu() {
+	mu.Lock()
+	hMenu, gdiObjs := buildMenu(topLevel)
+	mu.Unlock()
+
+	if hMenu == 0 {
+		return
+	}
+	defer func() {
+		procDestroyMenu.Call(uintptr(hMenu))
+		for _, obj := range gdiObjs {
+			deleteBitmap(obj)
+		}
+	}()
+
+	pt := POINT{}
+	procGetCursorPos.Call(uintptr(unsafe.Pointer(&pt)))
+
+	// Setting the window as foreground first is what makes the menu
+	// close when the user clicks outside of it.
+	procSetForegroundWindow.Call(uintptr(hWnd))
+	procTrackPopupMenu.Call(
+		uintptr(hMenu),
+		uintptr(TPM_BOTTOMALIGN|TPM_LEFTALIGN|TPM_RIGHTBUTTON),
+		uintptr(pt.X),
+		uintptr(pt.Y),
+		0,
+		uintptr(hWnd),
+		0,
+	)
+}
+
+// buildMenu recursively constructs an HMENU for menuItems via
+// InsertMenuItemW, returning it along with any icon bitmaps created
+// along the way so the caller can free them once the menu is torn down.
+// Called with mu held.
+func buildMenu(menuItems []*MenuItem) (windows.Handle, []windows.Handle) {
+	ret, _, _ := procCreatePopupMenu.Call()
+	hMenu := windows.Handle(ret)
+	if hMenu == 0 {
+		return 0, nil
+	}
+
+	var gdiObjs []windows.Handle
+	pos := uint32(0)
+
+	for _, item := range menuItems {
+		if item.hidden {
+			continue
+		}
+
+		if item.title == "" && item.id == 0 {
+			insertSeparator(hMenu, pos)
+			pos++
+			continue
+		}
+
+		textPtr, err := windows.UTF16PtrFromString(item.title)
+		if err != nil {
+			continue
+		}
+
+		mii := MENUITEMINFO{
+			FMask:      MIIM_ID | MIIM_STRING | MIIM_STATE,
+			FType:      MFT_STRING,
+			WID:        item.id,
+			DwTypeData: textPtr,
+		}
+		if item.disabled {
+			mii.FState |= MF_GRAYED
+		}
+		if item.checked {
+			mii.FState |= MF_CHECKED
+		}
+
+		if len(item.children) > 0 {
+			hSubMenu, childObjs := buildMenu(item.children)
+			gdiObjs = append(gdiObjs, childObjs...)
+			mii.FMask |= MIIM_SUBMENU
+			mii.HSubMenu = hSubMenu
+		}
+
+		if len(item.icon) > 0 {
+			if hIcon, err := loadIconFromBytes(item.icon); err == nil {
+				if hbmp, err := iconToMenuBitmap(hIcon); err == nil {
+					mii.FMask |= MIIM_BITMAP
+					mii.HbmpItem = hbmp
+					gdiObjs = append(gdiObjs, hbmp)
+				}
+				destroyIcon(hIcon)
+			}
+		}
+
+		mii.CbSize = uint32(unsafe.Sizeof(mii))
+		procInsertMenuItem.Call(uintptr(hMenu), uintptr(pos), 1, uintptr(unsafe.Pointer(&mii)))
+		pos++
+	}
+
+	return hMenu, gdiObjs
+}
+
+func insertSeparator(hMenu windows.Handle, pos uint32) {
+	mii := MENUITEMINFO{
+		FMask: MIIM_ID | MIIM_FTYPE,
+		FType: MFT_SEPARATOR,
+	}
+	mii.CbSize = uint32(unsafe.Sizeof(mii))
+	procInsertMenuItem.Call(uintptr(hMenu), uintptr(pos), 1, uintptr(unsafe.Pointer(&mii)))
+}
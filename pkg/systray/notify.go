@@ -0,0 +1,154 @@
+package systray
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	NIIF_INFO    = 0x00000001
+	NIIF_WARNING = 0x00000002
+	NIIF_ERROR   = 0x00000003
+	NIIF_USER    = 0x00000004
+
+	NIIF_NOSOUND            = 0x00000010
+	NIIF_LARGE_ICON         = 0x00000020
+	NIIF_RESPECT_QUIET_TIME = 0x00000080
+
+	NIM_SETVERSION       = 0x00000004
+	NOTIFYICON_VERSION_4 = 4
+
+	NIN_BALLOONSHOW      = 0x0402
+	NIN_BALLOONHIDE      = 0x0403
+	NIN_BALLOONTIMEOUT   = 0x0404
+	NIN_BALLOONUSERCLICK = 0x0405
+)
+
+// Severity selects the badge icon shown on a balloon notification.
+type Severity int
+
+const (
+	SeverityNone Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+	// SeverityUser shows NotifyOptions.BalloonIcon instead of a stock badge.
+	SeverityUser
+)
+
+// NotifyOptions controls how a balloon notification raised with Notify
+// is presented.
+type NotifyOptions struct {
+	Severity Severity
+
+	// NoSound suppresses the notification sound.
+	NoSound bool
+	// LargeIcon renders the balloon's icon at the larger Windows 10
+	// toast size instead of the classic balloon size.
+	LargeIcon bool
+	// RespectQuietTime suppresses the notification while the user has
+	// focus assist/quiet hours enabled.
+	RespectQuietTime bool
+
+	// BalloonIcon is the badge icon used when Severity is SeverityUser.
+	// It is interpreted the same way as SetIcon.
+	BalloonIcon []byte
+
+	// OnClick, if set, runs when the user clicks the balloon.
+	OnClick func()
+	// OnTimeout, if set, runs when the balloon dismisses on its own.
+	OnTimeout func()
+}
+
+var (
+	balloonOnClick   func()
+	balloonOnTimeout func()
+)
+
+// Notify raises a balloon notification from the tray icon.
+func Notify(title, body string, opts NotifyOptions) error {
+	mu.Lock()
+	balloonOnClick = opts.OnClick
+	balloonOnTimeout = opts.OnTimeout
+	mu.Unlock()
+
+	nid := notifyIconData{
+		CbSize:           uint32(unsafe.Sizeof(notifyIconData{})),
+		HWnd:             hWnd,
+		UID:              1,
+		UFlags:           NIF_INFO,
+		UCallbackMessage: WM_TRAYICON,
+	}
+
+	titleUTF16, err := windows.UTF16FromString(title)
+	if err != nil {
+		return fmt.Errorf("convert title to UTF-16: %w", err)
+	}
+	bodyUTF16, err := windows.UTF16FromString(body)
+	if err != nil {
+		return fmt.Errorf("convert body to UTF-16: %w", err)
+	}
+	copy(nid.SzInfoTitle[:], titleUTF16)
+	copy(nid.SzInfo[:], bodyUTF16)
+
+	switch opts.Severity {
+	case SeverityInfo:
+		nid.DwInfoFlags = NIIF_INFO
+	case SeverityWarning:
+		nid.DwInfoFlags = NIIF_WARNING
+	case SeverityError:
+		nid.DwInfoFlags = NIIF_ERROR
+	case SeverityUser:
+		nid.DwInfoFlags = NIIF_USER
+		if len(opts.BalloonIcon) > 0 {
+			icon, err := loadIconFromBytes(opts.BalloonIcon)
+			if err != nil {
+				return fmt.Errorf("load balloon icon: %w", err)
+			}
+			defer destroyIcon(icon)
+			nid.UFlags |= NIF_ICON
+			nid.HBalloonIcon = icon
+		}
+	default:
+		nid.DwInfoFlags = NIIF_NONE
+	}
+	if opts.NoSound {
+		nid.DwInfoFlags |= NIIF_NOSOUND
+	}
+	if opts.LargeIcon {
+		nid.DwInfoFlags |= NIIF_LARGE_ICON
+	}
+	if opts.RespectQuietTime {
+		nid.DwInfoFlags |= NIIF_RESPECT_QUIET_TIME
+	}
+
+	ret, _, err := procShellNotifyIcon.Call(NIM_MODIFY, uintptr(unsafe.Pointer(&nid)))
+	if ret == 0 {
+		return fmt.Errorf("Shell_NotifyIcon modify failed: %w", err)
+	}
+	return nil
+}
+
+// fireBalloonClick runs the OnClick callback from the most recent Notify
+// call, if any.
+func fireBalloonClick() {
+	mu.Lock()
+	cb := balloonOnClick
+	mu.Unlock()
+	if cb != nil {
+		cb()
+	}
+}
+
+// fireBalloonTimeout runs the OnTimeout callback from the most recent
+// Notify call, if any.
+func fireBalloonTimeout() {
+	mu.Lock()
+	cb := balloonOnTimeout
+	mu.Unlock()
+	if cb != nil {
+		cb()
+	}
+}
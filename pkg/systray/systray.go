@@ -0,0 +1,506 @@
+// Package systray provides a minimal Windows notification-area (system
+// tray) integration. The surface is modeled after the established Go
+// systray libraries: Run starts the message loop and blocks until Quit is
+// called, SetIcon/SetTooltip update the tray icon in place, and
+// AddMenuItem returns a handle for wiring up click handling.
+package systray
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// MAKEINTRESOURCE turns a resource ID into the pointer-sized value the
+// Win32 API expects in its place.
+func MAKEINTRESOURCE(id uint16) *uint16 {
+	return (*uint16)(unsafe.Pointer(uintptr(id)))
+}
+
+const (
+	WM_USER        = 0x0400
+	WM_TRAYICON    = WM_USER + 1
+	WM_COMMAND     = 0x0111
+	WM_RBUTTONDOWN = 0x0204
+	WM_MOUSEMOVE   = 0x0200
+	WM_LBUTTONDOWN = 0x0201
+	WM_RBUTTONUP   = 0x0205
+	WM_LBUTTONUP   = 0x0202
+	WM_ENDSESSION  = 0x0016
+	WM_DESTROY     = 0x0002
+	WM_CLOSE       = 0x0010
+	WM_NULL        = 0x0000
+	WM_APP         = 0x8000
+
+	NIM_ADD    = 0x00000000
+	NIM_MODIFY = 0x00000001
+	NIM_DELETE = 0x00000002
+
+	NIF_ICON    = 0x00000002
+	NIF_MESSAGE = 0x00000001
+	NIF_TIP     = 0x00000004
+	NIF_STATE   = 0x00000008
+	NIF_INFO    = 0x00000010
+
+	NIIF_NONE      = 0x00000000
+	NIS_HIDDEN     = 0x00000001
+	NIS_SHAREDICON = 0x00000002
+
+	IDI_APPLICATION = 32512
+	IDC_ARROW       = 32512
+
+	CS_HREDRAW    = 0x0001
+	CS_VREDRAW    = 0x0002
+	COLOR_WINDOW  = 5
+	CW_USEDEFAULT = ^0x7fffffff
+
+	// hwndMessage is HWND_MESSAGE: passing it as a window's parent makes
+	// Windows create a message-only window, which never appears in the
+	// shell, never receives WM_PAINT/activation traffic, and cannot be
+	// alt-tabbed to.
+	hwndMessage = ^uintptr(2)
+
+	// firstCommandID is the WM_COMMAND ID handed to the first menu item
+	// created with AddMenuItem/AddSubMenuItem. Starting well above
+	// WM_APP keeps generated IDs clear of any range the shell itself
+	// might use.
+	firstCommandID = WM_APP + 1024
+)
+
+var (
+	modKernel32 = windows.NewLazySystemDLL("Kernel32.dll")
+	modShell32  = windows.NewLazySystemDLL("shell32.dll")
+	modUser32   = windows.NewLazySystemDLL("user32.dll")
+
+	procShellNotifyIcon     = modShell32.NewProc("Shell_NotifyIconW")
+	procDestroyWindow       = modUser32.NewProc("DestroyWindow")
+	procGetMessage          = modUser32.NewProc("GetMessageW")
+	procCreateWindowEx      = modUser32.NewProc("CreateWindowExW")
+	procRegisterClass       = modUser32.NewProc("RegisterClassW")
+	procLoadIcon            = modUser32.NewProc("LoadIconW")
+	procGetModuleHandle     = modKernel32.NewProc("GetModuleHandleW")
+	procLoadCursor          = modUser32.NewProc("LoadCursorW")
+	procDefWindowProc       = modUser32.NewProc("DefWindowProcW")
+	procGetCursorPos        = modUser32.NewProc("GetCursorPos")
+	procCreatePopupMenu     = modUser32.NewProc("CreatePopupMenu")
+	procDestroyMenu         = modUser32.NewProc("DestroyMenu")
+	procAppendMenu          = modUser32.NewProc("AppendMenuW")
+	procSetForegroundWindow = modUser32.NewProc("SetForegroundWindow")
+	procTrackPopupMenu      = modUser32.NewProc("TrackPopupMenu")
+	procPostMessage         = modUser32.NewProc("PostMessageW")
+	procPostQuitMessage     = modUser32.NewProc("PostQuitMessage")
+	procDispatchMessage     = modUser32.NewProc("DispatchMessageW")
+
+	mu    sync.Mutex
+	hInst windows.Handle
+	hWnd  windows.HWND
+
+	onReady func()
+	onExit  func()
+
+	hIcon   windows.Handle
+	tooltip = "Go SysTray"
+)
+
+// POINT represents a Windows POINT structure.
+type POINT struct {
+	X, Y int32
+}
+
+type winMsg struct {
+	Hwnd    windows.Handle
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      POINT
+}
+
+// WindowClass represents the WNDCLASS structure.
+type WindowClass struct {
+	Style      uint32
+	WndProc    uintptr
+	CbClsExtra int32
+	CbWndExtra int32
+	Instance   windows.Handle
+	Icon       windows.Handle
+	Cursor     windows.Handle
+	Background windows.Handle
+	MenuName   *uint16
+	ClassName  *uint16
+}
+
+type notifyIconData struct {
+	CbSize           uint32
+	HWnd             windows.HWND
+	UID              uint32
+	UFlags           uint32
+	UCallbackMessage uint32
+	HIcon            windows.Handle
+	SzTip            [128]uint16
+	DwState          uint32
+	DwStateMask      uint32
+	SzInfo           [256]uint16 // Notification message
+	UVersion         uint32
+	SzInfoTitle      [64]uint16 // Notification title
+	DwInfoFlags      uint32     // Notification flags
+	GuidItem         windows.GUID
+	HBalloonIcon     windows.Handle
+}
+
+// Run creates the tray window, invokes onReady so the caller can set an
+// icon/tooltip and register menu items, then blocks running the Windows
+// message loop until Quit is called or the process receives SIGINT or
+// SIGTERM. If onExit is non-nil it runs after the message loop returns,
+// just before Run itself returns.
+func Run(onReadyFn, onExitFn func()) {
+	onReady = onReadyFn
+	onExit = onExitFn
+
+	handle, _, _ := procGetModuleHandle.Call(0)
+	if handle == 0 {
+		log.Fatal("GetModuleHandle failed: returned NULL")
+	}
+	hInst = windows.Handle(handle)
+
+	className, err := windows.UTF16PtrFromString("SysTrayWindowClass")
+	if err != nil {
+		log.Fatal("UTF16PtrFromString: ", err)
+	}
+
+	wndClass := WindowClass{
+		Style:      CS_HREDRAW | CS_VREDRAW,
+		WndProc:    windows.NewCallback(wndProc),
+		Instance:   hInst,
+		Icon:       loadIcon(0, IDI_APPLICATION),
+		Cursor:     loadCursor(0, IDC_ARROW),
+		Background: windows.Handle(COLOR_WINDOW + 1),
+		ClassName:  className,
+	}
+
+	if _, err = registerClass(&wndClass); err != nil {
+		log.Fatal("RegisterClass: ", err)
+	}
+
+	hWnd, err = createWindowEx(
+		0,
+		className,
+		nil,
+		0,
+		CW_USEDEFAULT,
+		CW_USEDEFAULT,
+		CW_USEDEFAULT,
+		CW_USEDEFAULT,
+		windows.Handle(hwndMessage),
+		0,
+		hInst,
+		nil)
+	if err != nil {
+		log.Fatal("CreateWindowEx: ", err)
+	}
+
+	registerTaskbarCreated()
+
+	if err = addTrayIcon(hWnd); err != nil {
+		log.Fatal("addTrayIcon: ", err)
+	}
+
+	if onReady != nil {
+		onReady()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		Quit()
+	}()
+
+	runMessageLoop()
+
+	if onExit != nil {
+		onExit()
+	}
+}
+
+// Quit removes the tray icon and posts WM_CLOSE to the tray window,
+// causing the message loop in Run to return.
+func Quit() {
+	if hWnd == 0 {
+		return
+	}
+	removeTrayIcon(hWnd)
+	postMessage(hWnd, WM_CLOSE, 0, 0)
+}
+
+// SetTitle sets the tray icon's title. The Windows tray has no separate
+// on-screen title distinct from the hover tooltip, so this is an alias
+// for SetTooltip kept for parity with the other systray libraries'
+// cross-platform API.
+func SetTitle(title string) error {
+	return SetTooltip(title)
+}
+
+// SetTooltip sets the text shown when the mouse hovers over the tray
+// icon.
+func SetTooltip(text string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nid := notifyIconData{
+		CbSize: uint32(unsafe.Sizeof(notifyIconData{})),
+		HWnd:   hWnd,
+		UID:    1,
+		UFlags: NIF_TIP,
+	}
+
+	szTip, err := windows.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+	copy(nid.SzTip[:], szTip)
+
+	ret, _, err := procShellNotifyIcon.Call(NIM_MODIFY, uintptr(unsafe.Pointer(&nid)))
+	if ret == 0 {
+		return fmt.Errorf("Shell_NotifyIcon modify failed: %w", err)
+	}
+	tooltip = text
+	return nil
+}
+
+// SetIcon sets the tray icon from raw ICO or PNG bytes, e.g. embedded via
+// go:embed.
+func SetIcon(iconBytes []byte) error {
+	icon, err := loadIconFromBytes(iconBytes)
+	if err != nil {
+		return err
+	}
+	return applyIcon(icon)
+}
+
+// applyIcon pushes icon onto the tray icon via NIM_MODIFY and destroys
+// the icon it replaces.
+func applyIcon(icon windows.Handle) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	nid := notifyIconData{
+		CbSize: uint32(unsafe.Sizeof(notifyIconData{})),
+		HWnd:   hWnd,
+		UID:    1,
+		UFlags: NIF_ICON,
+		HIcon:  icon,
+	}
+
+	ret, _, err := procShellNotifyIcon.Call(NIM_MODIFY, uintptr(unsafe.Pointer(&nid)))
+	if ret == 0 {
+		return fmt.Errorf("Shell_NotifyIcon modify failed: %w", err)
+	}
+
+	if hIcon != 0 {
+		destroyIcon(hIcon)
+	}
+	hIcon = icon
+	return nil
+}
+
+func postMessage(hwnd windows.HWND, msg uint32, wParam, lParam uintptr) bool {
+	ret, _, _ := procPostMessage.Call(
+		uintptr(hwnd),
+		uintptr(msg),
+		wParam,
+		lParam)
+	return ret != 0
+}
+
+func getMessage(msg *winMsg, hWnd windows.HWND, min, max uint32) int {
+	ret, _, _ := procGetMessage.Call(uintptr(unsafe.Pointer(msg)), uintptr(hWnd), uintptr(min), uintptr(max))
+	return int(ret)
+}
+
+func runMessageLoop() {
+	msg := &winMsg{}
+	for getMessage(msg, hWnd, 0, 0) > 0 {
+		// hWnd is message-only and never receives keyboard input, so
+		// there's nothing for TranslateMessage to translate - just
+		// dispatch straight to wndProc.
+		procDispatchMessage.Call(uintptr(unsafe.Pointer(msg)))
+	}
+}
+
+func wndProc(hwnd windows.HWND, msg uint32, wParam, lParam uintptr) (lResult uintptr) {
+	if taskbarCreatedMsg != 0 && msg == taskbarCreatedMsg {
+		if err := addTrayIcon(hwnd); err != nil {
+			log.Println("addTrayIcon after TaskbarCreated: ", err)
+		}
+		return
+	}
+
+	switch msg {
+	case WM_DESTROY:
+		procPostQuitMessage.Call(uintptr(int32(0)))
+		fallthrough
+	case WM_ENDSESSION:
+		removeTrayIcon(hwnd)
+	case WM_TRAYICON:
+		// NOTIFYICON_VERSION_4 packs the notification code into the low
+		// word of lParam (the high word carries the icon's UID).
+		switch uint32(lParam) & 0xffff {
+		case WM_MOUSEMOVE, WM_LBUTTONDOWN:
+			// Do nothing
+		case WM_RBUTTONUP:
+			showMenu()
+		case NIN_BALLOONUSERCLICK:
+			fireBalloonClick()
+		case NIN_BALLOONTIMEOUT:
+			fireBalloonTimeout()
+		case NIN_BALLOONSHOW, NIN_BALLOONHIDE:
+			// No hooks for these yet.
+		default:
+			// Unrecognized mouse/balloon event; ignore.
+		}
+	case WM_COMMAND:
+		dispatchCommand(uint32(wParam))
+	case WM_CLOSE:
+		destroyWindow(hwnd)
+	default:
+		lResult = defWindowProc(hwnd, msg, wParam, lParam)
+	}
+	return
+}
+
+// addTrayIcon adds the tray icon, using the currently configured icon
+// and tooltip (the defaults on first call, or whatever SetIcon/SetTooltip
+// last applied if called again after a TaskbarCreated notification).
+func addTrayIcon(hwnd windows.HWND) error {
+	// hIcon/tooltip are also written by SetIcon/SetTooltip from
+	// arbitrary caller goroutines, so guard the read - addTrayIcon can
+	// now be re-triggered from wndProc on TaskbarCreated, not just once
+	// at startup.
+	mu.Lock()
+	defer mu.Unlock()
+
+	icon := hIcon
+	if icon == 0 {
+		icon = loadIcon(0, IDI_APPLICATION)
+	}
+
+	nid := notifyIconData{
+		CbSize:           uint32(unsafe.Sizeof(notifyIconData{})),
+		HWnd:             hwnd,
+		UID:              1,
+		UFlags:           NIF_ICON | NIF_MESSAGE | NIF_TIP | NIF_STATE,
+		UCallbackMessage: WM_TRAYICON,
+		HIcon:            icon,
+		DwState:          0,
+		DwStateMask:      NIS_HIDDEN,
+	}
+
+	szTip, err := windows.UTF16FromString(tooltip)
+	if err != nil {
+		return err
+	}
+	copy(nid.SzTip[:], szTip)
+
+	ret, _, err := procShellNotifyIcon.Call(NIM_ADD, uintptr(unsafe.Pointer(&nid)))
+	if ret == 0 {
+		return fmt.Errorf("Shell_NotifyIcon add failed: %w", err)
+	}
+
+	nid.UFlags = NIF_STATE
+	nid.DwState = 0
+	ret, _, err = procShellNotifyIcon.Call(NIM_MODIFY, uintptr(unsafe.Pointer(&nid)))
+	if ret == 0 {
+		return fmt.Errorf("Shell_NotifyIcon modify failed: %w", err)
+	}
+
+	// Opt into version-4 balloon behavior so click/timeout/show/hide
+	// notifications arrive as NIN_BALLOON* messages in wndProc.
+	nid.UVersion = NOTIFYICON_VERSION_4
+	ret, _, err = procShellNotifyIcon.Call(NIM_SETVERSION, uintptr(unsafe.Pointer(&nid)))
+	if ret == 0 {
+		return fmt.Errorf("Shell_NotifyIcon setversion failed: %w", err)
+	}
+
+	return nil
+}
+
+func removeTrayIcon(hwnd windows.HWND) error {
+	nid := notifyIconData{
+		CbSize: uint32(unsafe.Sizeof(notifyIconData{})),
+		HWnd:   hwnd,
+		UID:    1,
+	}
+
+	ret, _, err := procShellNotifyIcon.Call(NIM_DELETE, uintptr(unsafe.Pointer(&nid)))
+	if ret == 0 {
+		return fmt.Errorf("Shell_NotifyIcon delete failed: %w", err)
+	}
+	return nil
+}
+
+func loadIcon(hInst windows.Handle, resourceId int) windows.Handle {
+	ret, _, err := procLoadIcon.Call(uintptr(hInst), uintptr(unsafe.Pointer(MAKEINTRESOURCE(uint16(resourceId)))))
+	if ret == 0 {
+		log.Println("LoadIcon failed: ", err)
+		return 0
+	}
+	return windows.Handle(ret)
+}
+
+func loadCursor(hInst windows.Handle, resourceId int) windows.Handle {
+	ret, _, err := procLoadCursor.Call(uintptr(hInst), uintptr(unsafe.Pointer(MAKEINTRESOURCE(uint16(resourceId)))))
+	if ret == 0 {
+		log.Println("LoadCursor failed: ", err)
+		return 0
+	}
+	return windows.Handle(ret)
+}
+
+func registerClass(wndClass *WindowClass) (uint16, error) {
+	ret, _, err := procRegisterClass.Call(uintptr(unsafe.Pointer(wndClass)))
+	if ret == 0 {
+		return 0, err
+	}
+	return uint16(ret), nil
+}
+
+func destroyWindow(hwnd windows.HWND) error {
+	ret, _, err := procDestroyWindow.Call(uintptr(hwnd))
+	if ret == 0 {
+		return fmt.Errorf("DestroyWindow failed: %w", err)
+	}
+	return nil
+}
+
+func createWindowEx(exStyle uint32, className, windowName *uint16, style uint32, x, y, width, height int, parent, menu, instance windows.Handle, param unsafe.Pointer) (windows.HWND, error) {
+	ret, _, err := procCreateWindowEx.Call(
+		uintptr(exStyle),
+		uintptr(unsafe.Pointer(className)),
+		uintptr(unsafe.Pointer(windowName)),
+		uintptr(style),
+		uintptr(x),
+		uintptr(y),
+		uintptr(width),
+		uintptr(height),
+		uintptr(parent),
+		uintptr(menu),
+		uintptr(instance),
+		uintptr(param),
+	)
+	if ret == 0 {
+		return 0, err
+	}
+	return windows.HWND(ret), nil
+}
+
+func defWindowProc(hwnd windows.HWND, msg uint32, wParam, lParam uintptr) uintptr {
+	ret, _, _ := procDefWindowProc.Call(uintptr(hwnd), uintptr(msg), wParam, lParam)
+	return ret
+}
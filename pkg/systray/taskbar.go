@@ -0,0 +1,36 @@
+package systray
+
+import (
+	"log"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procRegisterWindowMessage = modUser32.NewProc("RegisterWindowMessageW")
+
+	// taskbarCreatedMsg is the dynamic message ID Explorer broadcasts to
+	// every top-level window when it (re)starts, so tray icons lost in
+	// the crash/upgrade can be restored. 0 until registerTaskbarCreated
+	// runs.
+	taskbarCreatedMsg uint32
+)
+
+// registerTaskbarCreated obtains the "TaskbarCreated" message ID so
+// wndProc can recognize it and re-add the tray icon whenever Explorer
+// restarts.
+func registerTaskbarCreated() {
+	name, err := windows.UTF16PtrFromString("TaskbarCreated")
+	if err != nil {
+		log.Println("RegisterWindowMessage: ", err)
+		return
+	}
+
+	ret, _, err := procRegisterWindowMessage.Call(uintptr(unsafe.Pointer(name)))
+	if ret == 0 {
+		log.Println("RegisterWindowMessage failed: ", err)
+		return
+	}
+	taskbarCreatedMsg = uint32(ret)
+}